@@ -0,0 +1,25 @@
+package backends
+
+import (
+	"fmt"
+	"strings"
+)
+
+// commandTerminatesFlow reports whether name ends execution of the current
+// logic scope. pokeemerald/pokeruby and pokecrystal both use this
+// convention, so every backend shares it instead of repeating it.
+func commandTerminatesFlow(name string) bool {
+	return name == "end" || name == "return"
+}
+
+// emitRawStatement passes a raw statement through unmodified, a convention
+// shared by every backend.
+func emitRawStatement(sb *strings.Builder, value string) {
+	sb.WriteString(fmt.Sprintf("%s\n", value))
+}
+
+// emitCommand writes a tab-indented command line, the assembler-style
+// formatting shared by GBA and Crystal.
+func emitCommand(sb *strings.Builder, name string, args []string) {
+	sb.WriteString(fmt.Sprintf("\t%s\n", strings.TrimSpace(strings.Join(append([]string{name}, args...), " "))))
+}
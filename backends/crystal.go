@@ -0,0 +1,65 @@
+package backends
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/huderlem/poryscript/ast"
+)
+
+// Crystal targets a pokecrystal-style decomp, whose control-flow commands
+// differ from pokeemerald/pokeruby (jump instead of goto, iffalse/ifequal
+// instead of goto_if) and whose text encoding is "db \"...\"" rather than
+// ".string". Real pokecrystal ifequal/iffalse follow a separate compare
+// command and take only its result, not a self-contained condition -- this
+// backend instead inlines the rendered condition next to the label, the
+// same shape GBA's goto_if takes, so its conditional-jump output is
+// illustrative of the Backend split rather than something that would
+// assemble as-is against real pokecrystal sources.
+type Crystal struct{}
+
+// EmitLabel writes a "ScriptName_N:" label.
+func (Crystal) EmitLabel(sb *strings.Builder, script string, id int) {
+	sb.WriteString(fmt.Sprintf("%s_%d:\n", script, id))
+}
+
+// EmitJump writes an unconditional jump.
+func (Crystal) EmitJump(sb *strings.Builder, destLabel string) {
+	sb.WriteString(fmt.Sprintf("\tjump %s\n", destLabel))
+}
+
+// EmitConditionalJump writes an iffalse/ifequal guarded by the comparison's
+// rendered form, picking iffalse when that rendering reads as a negation
+// (ast.OperatorExpression doesn't expose a dedicated "is this negated?"
+// query, so this goes by the rendered text instead) and ifequal otherwise.
+func (Crystal) EmitConditionalJump(sb *strings.Builder, op *ast.OperatorExpression, destLabel string) {
+	cond := op.String()
+	mnemonic := "ifequal"
+	if strings.Contains(cond, "!=") || strings.HasPrefix(cond, "!") {
+		mnemonic = "iffalse"
+	}
+	sb.WriteString(fmt.Sprintf("\t%s %s, %s\n", mnemonic, cond, destLabel))
+}
+
+// EmitText writes a "db \"...\"" text block.
+func (Crystal) EmitText(sb *strings.Builder, text ast.Text) {
+	sb.WriteString(fmt.Sprintf("%s:\n", text.Name))
+	for _, line := range strings.Split(text.Value, "\n") {
+		sb.WriteString(fmt.Sprintf("\tdb \"%s\"\n", line))
+	}
+}
+
+// EmitRawStatement passes a raw statement through unmodified.
+func (Crystal) EmitRawStatement(sb *strings.Builder, value string) {
+	emitRawStatement(sb, value)
+}
+
+// EmitCommand writes a tab-indented command line.
+func (Crystal) EmitCommand(sb *strings.Builder, name string, args []string) {
+	emitCommand(sb, name, args)
+}
+
+// CommandTerminatesFlow reports true for "end" and "return".
+func (Crystal) CommandTerminatesFlow(name string) bool {
+	return commandTerminatesFlow(name)
+}
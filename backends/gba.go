@@ -0,0 +1,54 @@
+// Package backends implements emitter.Backend for the script engines that
+// Poryscript can target.
+package backends
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/huderlem/poryscript/ast"
+)
+
+// GBA is the original Poryscript output backend: pokeemerald/pokeruby
+// decomp-style assembler using "ScriptName_N:" labels, goto/goto_if, and
+// ".string" text blocks.
+type GBA struct{}
+
+// EmitLabel writes a "ScriptName_N:" label.
+func (GBA) EmitLabel(sb *strings.Builder, script string, id int) {
+	sb.WriteString(fmt.Sprintf("%s_%d:\n", script, id))
+}
+
+// EmitJump writes an unconditional goto.
+func (GBA) EmitJump(sb *strings.Builder, destLabel string) {
+	sb.WriteString(fmt.Sprintf("\tgoto %s\n", destLabel))
+}
+
+// EmitConditionalJump writes a goto_if guarded by the comparison's rendered
+// form.
+func (GBA) EmitConditionalJump(sb *strings.Builder, op *ast.OperatorExpression, destLabel string) {
+	sb.WriteString(fmt.Sprintf("\tgoto_if %s, %s\n", op.String(), destLabel))
+}
+
+// EmitText writes a ".string" text block.
+func (GBA) EmitText(sb *strings.Builder, text ast.Text) {
+	sb.WriteString(fmt.Sprintf("%s:\n", text.Name))
+	for _, line := range strings.Split(text.Value, "\n") {
+		sb.WriteString(fmt.Sprintf("\t.string \"%s\"\n", line))
+	}
+}
+
+// EmitRawStatement passes a raw statement through unmodified.
+func (GBA) EmitRawStatement(sb *strings.Builder, value string) {
+	emitRawStatement(sb, value)
+}
+
+// EmitCommand writes a tab-indented command line.
+func (GBA) EmitCommand(sb *strings.Builder, name string, args []string) {
+	emitCommand(sb, name, args)
+}
+
+// CommandTerminatesFlow reports true for "end" and "return".
+func (GBA) CommandTerminatesFlow(name string) bool {
+	return commandTerminatesFlow(name)
+}
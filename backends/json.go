@@ -0,0 +1,58 @@
+package backends
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/huderlem/poryscript/ast"
+)
+
+// JSON dumps the resolved chunk graph as a stream of JSON objects, one
+// instruction per line, for external tooling that wants Poryscript's
+// control-flow decisions without any particular assembler's syntax.
+type JSON struct{}
+
+func (JSON) writeLine(sb *strings.Builder, v interface{}) {
+	encoded, err := json.Marshal(v)
+	if err != nil {
+		return
+	}
+	sb.Write(encoded)
+	sb.WriteString("\n")
+}
+
+// EmitLabel writes a {"op":"label",...} line.
+func (JSON) EmitLabel(sb *strings.Builder, script string, id int) {
+	JSON{}.writeLine(sb, map[string]interface{}{"op": "label", "script": script, "id": id})
+}
+
+// EmitJump writes a {"op":"jump",...} line.
+func (JSON) EmitJump(sb *strings.Builder, destLabel string) {
+	JSON{}.writeLine(sb, map[string]interface{}{"op": "jump", "dest": destLabel})
+}
+
+// EmitConditionalJump writes a {"op":"condJump",...} line.
+func (JSON) EmitConditionalJump(sb *strings.Builder, op *ast.OperatorExpression, destLabel string) {
+	JSON{}.writeLine(sb, map[string]interface{}{"op": "condJump", "cond": op.String(), "dest": destLabel})
+}
+
+// EmitText writes a {"op":"text",...} line.
+func (JSON) EmitText(sb *strings.Builder, text ast.Text) {
+	JSON{}.writeLine(sb, map[string]interface{}{"op": "text", "name": text.Name, "value": text.Value})
+}
+
+// EmitRawStatement writes a {"op":"raw",...} line.
+func (JSON) EmitRawStatement(sb *strings.Builder, value string) {
+	JSON{}.writeLine(sb, map[string]interface{}{"op": "raw", "value": value})
+}
+
+// EmitCommand writes a {"op":"command",...} line.
+func (JSON) EmitCommand(sb *strings.Builder, name string, args []string) {
+	JSON{}.writeLine(sb, map[string]interface{}{"op": "command", "name": name, "args": args})
+}
+
+// CommandTerminatesFlow reports true for "end" and "return", matching the
+// GBA/Crystal decomp conventions the chunk splitter was built around.
+func (JSON) CommandTerminatesFlow(name string) bool {
+	return commandTerminatesFlow(name)
+}
@@ -0,0 +1,39 @@
+package emitter
+
+import (
+	"strings"
+
+	"github.com/huderlem/poryscript/ast"
+)
+
+// Backend defines the concrete output syntax for a scripting target. The
+// emitter owns control-flow structure -- splitting scripts into chunks,
+// ordering them, tunneling and tail-duplicating -- while a Backend owns only
+// how that structure is spelled out as text: labels, jumps, conditional
+// jumps, text blocks, ordinary commands, raw passthrough statements, and
+// which commands end the current logic scope. chunk.go's
+// renderLabel/renderBranching/renderStatements render a chunk's own
+// statements and branchBehavior through this interface -- every line a
+// chunk can produce goes through some Backend method, so a backend like
+// JSON that doesn't use plain assembler text stays self-consistent.
+type Backend interface {
+	// EmitLabel writes the label that identifies chunk id within script.
+	EmitLabel(sb *strings.Builder, script string, id int)
+	// EmitJump writes an unconditional jump to destLabel.
+	EmitJump(sb *strings.Builder, destLabel string)
+	// EmitConditionalJump writes a conditional jump to destLabel, guarded by
+	// the given comparison expression.
+	EmitConditionalJump(sb *strings.Builder, op *ast.OperatorExpression, destLabel string)
+	// EmitText writes a text block.
+	EmitText(sb *strings.Builder, text ast.Text)
+	// EmitRawStatement writes a raw statement through to the output
+	// unmodified.
+	EmitRawStatement(sb *strings.Builder, value string)
+	// EmitCommand writes an ordinary command statement (name plus its
+	// arguments).
+	EmitCommand(sb *strings.Builder, name string, args []string)
+	// CommandTerminatesFlow reports whether the named command ends
+	// execution of the current logic scope (e.g. "end"/"return" on GBA),
+	// so the chunk splitter knows to stop processing into the chunk.
+	CommandTerminatesFlow(name string) bool
+}
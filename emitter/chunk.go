@@ -0,0 +1,144 @@
+package emitter
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/huderlem/poryscript/ast"
+)
+
+// chunk is a self-contained run of script logic that falls through into
+// more statements, or ends in some kind of branch: an unconditional jump, a
+// break/continue, or a boolean condition.
+type chunk struct {
+	id             int
+	returnID       int
+	statements     []ast.Statement
+	branchBehavior branchBehavior
+}
+
+// branchBehavior describes how a chunk transfers control once its
+// statements are exhausted.
+type branchBehavior interface {
+	// getTailChunkID returns the chunk this branch would naturally land on
+	// if it were placed immediately afterward in the layout, avoiding an
+	// explicit jump, or -1 if there's no single such chunk.
+	getTailChunkID() int
+}
+
+// jump is an unconditional transfer to destChunkID.
+type jump struct {
+	destChunkID int
+}
+
+func (j *jump) getTailChunkID() int {
+	return j.destChunkID
+}
+
+// breakContext is an unconditional transfer used to implement break and
+// continue. It targets a chunk the same way jump does, but it is kept as
+// its own type and handled differently: renderBranching always writes an
+// explicit jump for it, even when destChunkID is the next chunk in the
+// layout, tunnelChunks never folds a breakContext chunk away, and
+// tailDuplicateChunks never retargets it.
+type breakContext struct {
+	destChunkID int
+}
+
+func (b *breakContext) getTailChunkID() int {
+	return b.destChunkID
+}
+
+// conditionDestination is where control goes when operatorExpression
+// evaluates true.
+type conditionDestination struct {
+	id                 int
+	operatorExpression *ast.OperatorExpression
+}
+
+// leafExpressionBranch is the branch at the bottom of a boolean expression
+// tree: jump to truthyDest.id if the comparison holds, otherwise fall
+// through to falseyReturnID.
+type leafExpressionBranch struct {
+	truthyDest     *conditionDestination
+	falseyReturnID int
+}
+
+func (l *leafExpressionBranch) getTailChunkID() int {
+	return -1
+}
+
+// splitChunkForBranch finalizes everything in curChunk after statement
+// index i into a fresh chunk that a branch being created should resume at
+// once it returns, and appends that chunk to remainingChunks.
+func (c *chunk) splitChunkForBranch(i int, chunkCounter *int, remainingChunks []*chunk) ([]*chunk, int) {
+	*chunkCounter++
+	returnChunk := &chunk{
+		id:         *chunkCounter,
+		returnID:   c.returnID,
+		statements: c.statements[i+1:],
+	}
+	remainingChunks = append(remainingChunks, returnChunk)
+	return remainingChunks, returnChunk.id
+}
+
+// renderStatements writes every command statement in the chunk, through
+// backend -- a target like JSON that isn't plain assembler text needs every
+// line routed through Backend, not just control flow.
+func (c *chunk) renderStatements(sb *strings.Builder, backend Backend) {
+	for _, stmt := range c.statements {
+		commandStmt, ok := stmt.(*ast.CommandStatement)
+		if !ok {
+			continue
+		}
+		backend.EmitCommand(sb, commandStmt.Name.Value, commandStmt.Args)
+	}
+}
+
+// label returns the label identifying chunk id within script.
+func label(script string, id int) string {
+	return fmt.Sprintf("%s_%d", script, id)
+}
+
+// renderLabel writes the label that identifies this chunk within script,
+// using backend's label syntax.
+func (c *chunk) renderLabel(script string, sb *strings.Builder, backend Backend) {
+	backend.EmitLabel(sb, script, c.id)
+}
+
+// renderBranching writes whatever instruction ends this chunk, in backend's
+// syntax, and reports whether control actually falls through to
+// nextChunkID -- meaning no instruction needed to be written at all.
+func (c *chunk) renderBranching(script string, sb *strings.Builder, nextChunkID int, registerJumpChunk func(int), backend Backend) bool {
+	switch b := c.branchBehavior.(type) {
+	case nil:
+		if c.returnID == -1 || c.returnID == nextChunkID {
+			return true
+		}
+		registerJumpChunk(c.returnID)
+		backend.EmitJump(sb, label(script, c.returnID))
+		return false
+	case *jump:
+		if b.destChunkID == nextChunkID {
+			return true
+		}
+		registerJumpChunk(b.destChunkID)
+		backend.EmitJump(sb, label(script, b.destChunkID))
+		return false
+	case *breakContext:
+		registerJumpChunk(b.destChunkID)
+		backend.EmitJump(sb, label(script, b.destChunkID))
+		return false
+	case *leafExpressionBranch:
+		registerJumpChunk(b.truthyDest.id)
+		backend.EmitConditionalJump(sb, b.truthyDest.operatorExpression, label(script, b.truthyDest.id))
+		if b.falseyReturnID == nextChunkID {
+			return true
+		}
+		registerJumpChunk(b.falseyReturnID)
+		backend.EmitJump(sb, label(script, b.falseyReturnID))
+		return false
+	default:
+		return true
+	}
+}
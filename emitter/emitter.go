@@ -8,20 +8,31 @@ import (
 	"github.com/huderlem/poryscript/token"
 
 	"github.com/huderlem/poryscript/ast"
+	"github.com/huderlem/poryscript/peephole"
 )
 
 // Emitter is responsible for transforming a parsed Poryscript program into
 // the target assembler bytecode script.
 type Emitter struct {
-	program  *ast.Program
-	optimize bool
+	program      *ast.Program
+	optimize     bool
+	noDuplicate  bool
+	peepholeMode peephole.Mode
+	backend      Backend
 }
 
-// New creates a new Poryscript program emitter.
-func New(program *ast.Program, optimize bool) *Emitter {
+// New creates a new Poryscript program emitter. noDuplicate disables the
+// tail-duplication pass that would otherwise run as part of optimize (see
+// the --no-duplicate CLI flag), peepholeMode controls the --peephole CLI
+// knob, and backend selects the concrete output syntax (see the --target
+// CLI flag and the backends package).
+func New(program *ast.Program, optimize bool, noDuplicate bool, peepholeMode peephole.Mode, backend Backend) *Emitter {
 	return &Emitter{
-		program:  program,
-		optimize: optimize,
+		program:      program,
+		optimize:     optimize,
+		noDuplicate:  noDuplicate,
+		peepholeMode: peepholeMode,
+		backend:      backend,
 	}
 }
 
@@ -43,7 +54,7 @@ func (e *Emitter) Emit() string {
 
 		rawStmt, ok := stmt.(*ast.RawStatement)
 		if ok {
-			sb.WriteString(emitRawStatement(rawStmt))
+			sb.WriteString(e.emitRawStatement(rawStmt))
 			i++
 			continue
 		}
@@ -57,7 +68,7 @@ func (e *Emitter) Emit() string {
 			sb.WriteString("\n")
 		}
 
-		emitted := emitText(text)
+		emitted := e.emitText(text)
 		sb.WriteString(emitted)
 	}
 	return sb.String()
@@ -97,7 +108,7 @@ func (e *Emitter) emitScriptStatement(scriptStmt *ast.ScriptStatement) string {
 			// "end" and "return" are special control-flow commands that end execution of
 			// the current logic scope. Therefore, we should not process any further into the
 			// current chunk, and mark it as finalized.
-			if commandStmt.Name.Value == "end" || commandStmt.Name.Value == "return" {
+			if e.backend.CommandTerminatesFlow(commandStmt.Name.Value) {
 				completeChunk := &chunk{id: curChunk.id, returnID: -1, statements: curChunk.statements[:i]}
 				finalChunks[completeChunk.id] = completeChunk
 				shouldContinue = true
@@ -184,7 +195,15 @@ func (e *Emitter) emitScriptStatement(scriptStmt *ast.ScriptStatement) string {
 		}
 	}
 
-	return e.renderChunks(finalChunks, scriptStmt.Name.Value)
+	loopTargets := make(map[int]bool, len(loopStatementReturnChunks)+len(loopStatementOriginChunks))
+	for _, id := range loopStatementReturnChunks {
+		loopTargets[id] = true
+	}
+	for _, id := range loopStatementOriginChunks {
+		loopTargets[id] = true
+	}
+
+	return e.renderChunks(finalChunks, scriptStmt.Name.Value, loopTargets, &chunkCounter)
 }
 
 func createConditionDestination(destinationChunk int, operatorExpression *ast.OperatorExpression) *conditionDestination {
@@ -358,11 +377,15 @@ func createDoWhileStatementChunks(stmt *ast.DoWhileStatement, i int, curChunk *c
 	return remainingChunks, &jump{destChunkID: consequenceChunk.id}, returnID
 }
 
-func (e *Emitter) renderChunks(chunks map[int]*chunk, scriptName string) string {
+func (e *Emitter) renderChunks(chunks map[int]*chunk, scriptName string, loopTargets map[int]bool, chunkCounter *int) string {
 	// Get sorted list of final chunk ids.
 	var chunkIDs []int
 	if e.optimize {
+		chunks, loopTargets = tunnelChunks(chunks, loopTargets)
 		chunkIDs = optimizeChunkOrder(chunks)
+		if !e.noDuplicate {
+			chunkIDs, chunks = tailDuplicateChunks(chunks, chunkIDs, chunkCounter, loopTargets)
+		}
 	} else {
 		chunkIDs = make([]int, 0)
 		for k := range chunks {
@@ -389,8 +412,11 @@ func (e *Emitter) renderChunks(chunks map[int]*chunk, scriptName string) string
 			nextChunkID = -1
 		}
 		chunk := chunks[chunkID]
-		chunk.renderStatements(&sb)
-		isFallThrough := chunk.renderBranching(scriptName, &sb, nextChunkID, registerJumpChunk)
+		if e.optimize && e.peepholeMode != peephole.Off {
+			chunk.statements = peephole.Run(chunk.statements, e.peepholeMode)
+		}
+		chunk.renderStatements(&sb, e.backend)
+		isFallThrough := chunk.renderBranching(scriptName, &sb, nextChunkID, registerJumpChunk, e.backend)
 		if !isFallThrough {
 			sb.WriteString("\n")
 		}
@@ -403,7 +429,7 @@ func (e *Emitter) renderChunks(chunks map[int]*chunk, scriptName string) string
 	for _, chunkID := range chunkIDs {
 		chunk := chunks[chunkID]
 		if chunkID == 0 || jumpChunks[chunkID] {
-			chunk.renderLabel(scriptName, &sb)
+			chunk.renderLabel(scriptName, &sb, e.backend)
 		}
 		sb.WriteString(chunkBodies[chunkID].String())
 	}
@@ -411,13 +437,332 @@ func (e *Emitter) renderChunks(chunks map[int]*chunk, scriptName string) string
 	return sb.String()
 }
 
+// tunnelChunks collapses the empty "linker" chunks that splitBooleanExpressionChunks
+// and the loop chunk constructors leave behind -- chunks with no statements whose
+// entire branchBehavior is an unconditional jump to another chunk. Every reference
+// to a tunneled chunk (jump, breakContext, conditionDestination, leafExpressionBranch,
+// and returnID) is rewritten to point straight at its ultimate destination, and the
+// now-unreachable intermediate chunks are dropped from the returned map. This mirrors
+// CompCert-style branch tunneling.
+//
+// loopTargets holds the chunk ids that break/continue address directly; since
+// tunneling can fold one of those ids into another chunk, it's rewritten
+// through the same union-find and returned alongside chunks so callers keep
+// pointing at the right (possibly now-merged) chunk.
+func tunnelChunks(chunks map[int]*chunk, loopTargets map[int]bool) (map[int]*chunk, map[int]bool) {
+	ids := make([]int, 0, len(chunks))
+	for id := range chunks {
+		ids = append(ids, id)
+	}
+	uf := newTunnelUnionFind(ids)
+
+	// Union every empty jump-only chunk with its destination. Chunks that carry
+	// commands, a conditional leafExpressionBranch, or no branch at all stay as
+	// their own root.
+	for id, c := range chunks {
+		if len(c.statements) != 0 {
+			continue
+		}
+		j, ok := c.branchBehavior.(*jump)
+		if !ok {
+			continue
+		}
+		uf.union(id, j.destChunkID)
+	}
+
+	for _, c := range chunks {
+		if c.returnID != -1 {
+			c.returnID = uf.find(c.returnID)
+		}
+		switch b := c.branchBehavior.(type) {
+		case *jump:
+			b.destChunkID = uf.find(b.destChunkID)
+		case *breakContext:
+			b.destChunkID = uf.find(b.destChunkID)
+		case *leafExpressionBranch:
+			b.truthyDest.id = uf.find(b.truthyDest.id)
+			b.falseyReturnID = uf.find(b.falseyReturnID)
+		}
+	}
+
+	// Only chunks reachable from the entry chunk (id 0) via the rewritten graph
+	// are kept. Everything else is a now-unreferenced intermediate chunk.
+	reachable := map[int]bool{0: true}
+	queue := []int{0}
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		c, ok := chunks[id]
+		if !ok {
+			continue
+		}
+		for _, dest := range branchDestinations(c) {
+			if !reachable[dest] {
+				reachable[dest] = true
+				queue = append(queue, dest)
+			}
+		}
+	}
+
+	final := make(map[int]*chunk, len(reachable))
+	for id, c := range chunks {
+		if reachable[id] {
+			final[id] = c
+		}
+	}
+
+	rewrittenLoopTargets := make(map[int]bool, len(loopTargets))
+	for id := range loopTargets {
+		rewrittenLoopTargets[uf.find(id)] = true
+	}
+
+	return final, rewrittenLoopTargets
+}
+
+// branchDestinations returns every chunk id that c can transfer control to:
+// its returnID fall-through (only a real edge when branchBehavior is nil --
+// leafExpressionBranch chunks never set returnID, so it defaults to the
+// zero value and must not be read as "falls through to chunk 0"), plus
+// whatever its branchBehavior targets.
+func branchDestinations(c *chunk) []int {
+	dests := []int{}
+	if c.branchBehavior == nil {
+		if c.returnID != -1 {
+			dests = append(dests, c.returnID)
+		}
+	}
+	switch b := c.branchBehavior.(type) {
+	case *jump:
+		dests = append(dests, b.destChunkID)
+	case *breakContext:
+		dests = append(dests, b.destChunkID)
+	case *leafExpressionBranch:
+		dests = append(dests, b.truthyDest.id, b.falseyReturnID)
+	}
+	return dests
+}
+
+// tunnelUnionFind is a union-find structure used to resolve the transitive
+// destination of chains of tunneled chunks. Chunks are unioned with their
+// destination, and find() resolves a chunk id to the representative of its
+// set, compressing the path as it goes. Degenerate cycles (e.g. an empty
+// `while (true) {}` that tunnels into itself) are detected while walking the
+// parent chain: as soon as a node is revisited, that node is used as the
+// canonical representative for the whole cycle instead of looping forever.
+type tunnelUnionFind struct {
+	parent map[int]int
+}
+
+func newTunnelUnionFind(ids []int) *tunnelUnionFind {
+	parent := make(map[int]int, len(ids))
+	for _, id := range ids {
+		parent[id] = id
+	}
+	return &tunnelUnionFind{parent: parent}
+}
+
+func (u *tunnelUnionFind) find(id int) int {
+	visited := map[int]bool{}
+	path := []int{}
+	cur := id
+	for !visited[cur] {
+		visited[cur] = true
+		path = append(path, cur)
+		next, ok := u.parent[cur]
+		if !ok || next == cur {
+			break
+		}
+		cur = next
+	}
+	root := cur
+	for _, node := range path {
+		u.parent[node] = root
+	}
+	return root
+}
+
+func (u *tunnelUnionFind) union(child, dest int) {
+	childRoot := u.find(child)
+	destRoot := u.find(dest)
+	u.parent[childRoot] = destRoot
+}
+
+// MaxDuplicationCost is the rendered-size threshold under which a chunk is
+// considered cheap enough to tail-duplicate into its jump-predecessors. See
+// tailDuplicateChunks and chunkCost.
+const MaxDuplicationCost = 3
+
+// tailDuplicateChunks clones small chunks that have more than one predecessor
+// into each predecessor that currently reaches them with an unconditional
+// jump, so that predecessor can instead fall through into its own private
+// copy and avoid emitting a goto. chunkIDs is the layout chosen by
+// optimizeChunkOrder; each clone is inserted immediately after the
+// predecessor it was made for, so the predecessor falls through locally.
+// loopTargets are chunks addressed directly by a break or continue
+// statement, which must never be duplicated since doing so would leave
+// some break/continue statements jumping to a stale copy.
+func tailDuplicateChunks(chunks map[int]*chunk, chunkIDs []int, chunkCounter *int, loopTargets map[int]bool) ([]int, map[int]*chunk) {
+	predecessors := make(map[int][]int)
+	for id, c := range chunks {
+		for _, dest := range branchDestinations(c) {
+			predecessors[dest] = append(predecessors[dest], id)
+		}
+	}
+
+	position := make(map[int]int, len(chunkIDs))
+	for i, id := range chunkIDs {
+		position[id] = i
+	}
+
+	for _, cID := range append([]int{}, chunkIDs...) {
+		c, ok := chunks[cID]
+		if !ok || loopTargets[cID] || len(predecessors[cID]) < 2 || chunkCost(c) >= MaxDuplicationCost {
+			continue
+		}
+
+		duplicated := false
+		for _, pID := range predecessors[cID] {
+			p, ok := chunks[pID]
+			if !ok || !unconditionallyJumpsTo(p, cID) {
+				continue
+			}
+			if position[pID]+1 == position[cID] {
+				// Already falls through for free; duplicating here wouldn't
+				// remove a goto.
+				continue
+			}
+
+			*chunkCounter++
+			clone := &chunk{
+				id:             *chunkCounter,
+				returnID:       c.returnID,
+				statements:     c.statements,
+				branchBehavior: cloneBranchBehavior(c.branchBehavior),
+			}
+			chunks[clone.id] = clone
+			retargetJump(p, clone.id)
+			duplicated = true
+
+			insertAt := position[pID] + 1
+			chunkIDs = append(chunkIDs, 0)
+			copy(chunkIDs[insertAt+1:], chunkIDs[insertAt:])
+			chunkIDs[insertAt] = clone.id
+			for i := insertAt; i < len(chunkIDs); i++ {
+				position[chunkIDs[i]] = i
+			}
+		}
+
+		// If every predecessor reached cID through the jumps just retargeted,
+		// cID is now dead: nothing refers to it. Drop it instead of emitting
+		// it as unreachable filler, which would grow rather than shrink the
+		// output.
+		if duplicated && !hasPredecessor(chunks, cID) {
+			delete(chunks, cID)
+			chunkIDs, position = removeChunkID(chunkIDs, position, cID)
+		}
+	}
+
+	return chunkIDs, chunks
+}
+
+// unconditionallyJumpsTo reports whether p transfers control to cID
+// unconditionally -- either through an explicit jump, or implicitly by
+// falling through its returnID with no branchBehavior of its own. Both are
+// candidates for tail duplication: whichever of them isn't already
+// physically adjacent to cID in the chosen layout renders as a goto.
+func unconditionallyJumpsTo(p *chunk, cID int) bool {
+	switch b := p.branchBehavior.(type) {
+	case nil:
+		return p.returnID == cID
+	case *jump:
+		return b.destChunkID == cID
+	default:
+		return false
+	}
+}
+
+// retargetJump repoints whichever unconditional edge unconditionallyJumpsTo
+// found on p to newDest, whether that edge is an explicit jump or an
+// implicit returnID fall-through.
+func retargetJump(p *chunk, newDest int) {
+	if j, ok := p.branchBehavior.(*jump); ok {
+		j.destChunkID = newDest
+		return
+	}
+	p.returnID = newDest
+}
+
+// hasPredecessor reports whether any chunk still transfers control to target.
+func hasPredecessor(chunks map[int]*chunk, target int) bool {
+	for _, c := range chunks {
+		for _, dest := range branchDestinations(c) {
+			if dest == target {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// removeChunkID deletes id from chunkIDs and reindexes position accordingly.
+func removeChunkID(chunkIDs []int, position map[int]int, id int) ([]int, map[int]int) {
+	idx, ok := position[id]
+	if !ok {
+		return chunkIDs, position
+	}
+	chunkIDs = append(chunkIDs[:idx], chunkIDs[idx+1:]...)
+	delete(position, id)
+	for i := idx; i < len(chunkIDs); i++ {
+		position[chunkIDs[i]] = i
+	}
+	return chunkIDs, position
+}
+
+// cloneBranchBehavior deep-copies a chunk's branchBehavior so a duplicated
+// chunk doesn't alias the original's (and every other clone's) jump target --
+// otherwise retargeting one clone's jump would retarget all of them.
+func cloneBranchBehavior(b branchBehavior) branchBehavior {
+	clone := b
+	switch v := b.(type) {
+	case *jump:
+		copied := *v
+		clone = &copied
+	case *breakContext:
+		copied := *v
+		clone = &copied
+	case *leafExpressionBranch:
+		copied := *v
+		truthyDest := *v.truthyDest
+		copied.truthyDest = &truthyDest
+		clone = &copied
+	}
+	return clone
+}
+
+// chunkCost estimates how large a chunk will render as: its statement count
+// plus a small surcharge for whatever branch ends it. It's compared against
+// MaxDuplicationCost to decide whether a chunk is cheap enough to duplicate.
+func chunkCost(c *chunk) int {
+	cost := len(c.statements)
+	switch c.branchBehavior.(type) {
+	case *jump, *breakContext:
+		cost++
+	case *leafExpressionBranch:
+		cost += 2
+	}
+	return cost
+}
+
 // Reorders chunks to take advantage of fall-throughs, rather than using
 // unncessary wasteful "goto" commands.
 func optimizeChunkOrder(chunks map[int]*chunk) []int {
-	unvisited := make(map[int]bool)
+	unvisited := make(map[int]bool, len(chunks))
+	sortedIDs := make([]int, 0, len(chunks))
 	for k := range chunks {
 		unvisited[k] = true
+		sortedIDs = append(sortedIDs, k)
 	}
+	sort.Ints(sortedIDs)
 
 	chunkIDs := make([]int, 0)
 	if len(chunks) == 0 {
@@ -444,12 +789,17 @@ func optimizeChunkOrder(chunks map[int]*chunk) []int {
 			}
 		}
 
-		// Choose random unvisited chunk for the next one.
-		for i < len(chunks) {
-			_, ok := unvisited[i]
-			if ok {
-				chunkIDs = append(chunkIDs, i)
-				delete(unvisited, i)
+		// Choose the next lowest-numbered unvisited chunk. Chunk ids can be
+		// sparse once tunnelChunks has dropped some of them, so walk the
+		// sorted key list instead of assuming a dense 0..len(chunks) range --
+		// otherwise a surviving chunk with a high id that's only ever a
+		// branch target (never a tail) would never get picked, and this loop
+		// would never terminate.
+		for i < len(sortedIDs) {
+			candidate := sortedIDs[i]
+			if unvisited[candidate] {
+				chunkIDs = append(chunkIDs, candidate)
+				delete(unvisited, candidate)
 				break
 			}
 			i++
@@ -458,18 +808,14 @@ func optimizeChunkOrder(chunks map[int]*chunk) []int {
 	return chunkIDs
 }
 
-func emitText(text ast.Text) string {
+func (e *Emitter) emitText(text ast.Text) string {
 	var sb strings.Builder
-	sb.WriteString(fmt.Sprintf("%s:\n", text.Name))
-	lines := strings.Split(text.Value, "\n")
-	for _, line := range lines {
-		sb.WriteString(fmt.Sprintf("\t.string \"%s\"\n", line))
-	}
+	e.backend.EmitText(&sb, text)
 	return sb.String()
 }
 
-func emitRawStatement(rawStmt *ast.RawStatement) string {
+func (e *Emitter) emitRawStatement(rawStmt *ast.RawStatement) string {
 	var sb strings.Builder
-	sb.WriteString(fmt.Sprintf("%s\n", rawStmt.Value))
+	e.backend.EmitRawStatement(&sb, rawStmt.Value)
 	return sb.String()
 }
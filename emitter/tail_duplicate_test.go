@@ -0,0 +1,58 @@
+package emitter
+
+import "testing"
+
+// TestTailDuplicateChunksRemovesRedundantGotoEndif builds the chunk graph
+// for a short if/else whose branches both fall through into a shared tail
+// chunk ("endif"). optimizeChunkOrder can only place one of the two
+// branches directly before that tail, so the other branch must get its own
+// private clone to fall through into instead of rendering a goto back to
+// the shared chunk.
+func TestTailDuplicateChunksRemovesRedundantGotoEndif(t *testing.T) {
+	const (
+		entry = 0
+		then  = 1
+		endif = 2
+		els   = 3
+	)
+
+	chunks := map[int]*chunk{
+		entry: {id: entry, branchBehavior: &leafExpressionBranch{
+			truthyDest:     &conditionDestination{id: then},
+			falseyReturnID: els,
+		}},
+		then:  {id: then, returnID: endif},
+		els:   {id: els, returnID: endif},
+		endif: {id: endif, returnID: -1},
+	}
+
+	order := optimizeChunkOrder(chunks)
+	chunkCounter := 3
+	order, chunks = tailDuplicateChunks(chunks, order, &chunkCounter, map[int]bool{})
+
+	position := make(map[int]int, len(order))
+	for i, id := range order {
+		position[id] = i
+	}
+
+	for _, id := range []int{then, els} {
+		c := chunks[id]
+		if c.returnID == endif {
+			if position[id]+1 != position[endif] {
+				t.Fatalf("chunk %d returns to shared endif chunk %d but isn't placed immediately before it (chunk at %d, endif at %d) -- this would render as a goto", id, endif, position[id], position[endif])
+			}
+			continue
+		}
+
+		clone, ok := chunks[c.returnID]
+		if !ok {
+			t.Fatalf("chunk %d's return target %d does not exist", id, c.returnID)
+		}
+		if clone.id == endif {
+			t.Errorf("chunk %d still points at the shared endif chunk %d instead of a private clone", id, endif)
+		}
+		if position[id]+1 != position[clone.id] {
+			t.Errorf("chunk %d's private clone %d isn't placed immediately after it, so it would still render a goto", id, clone.id)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package emitter
+
+import "testing"
+
+// TestTunnelChunksCollapsesAndChain builds the chunk graph that
+// splitBooleanExpressionChunks produces for "if (flag_a && flag_b && flag_c)"
+// -- three leafExpressionBranch chunks threaded together by empty
+// jump-only linker chunks -- and checks that tunnelChunks collapses it down
+// to one conditional per leaf with no intervening gotos.
+func TestTunnelChunksCollapsesAndChain(t *testing.T) {
+	const (
+		entry = 0
+		leafA = 1
+		linkA = 2
+		leafB = 3
+		linkB = 4
+		leafC = 5
+		then  = 6
+		els   = 7
+	)
+
+	chunks := map[int]*chunk{
+		entry: {id: entry, branchBehavior: &jump{destChunkID: leafA}},
+		leafA: {id: leafA, branchBehavior: &leafExpressionBranch{
+			truthyDest:     &conditionDestination{id: linkA},
+			falseyReturnID: els,
+		}},
+		linkA: {id: linkA, branchBehavior: &jump{destChunkID: leafB}},
+		leafB: {id: leafB, branchBehavior: &leafExpressionBranch{
+			truthyDest:     &conditionDestination{id: linkB},
+			falseyReturnID: els,
+		}},
+		linkB: {id: linkB, branchBehavior: &jump{destChunkID: leafC}},
+		leafC: {id: leafC, branchBehavior: &leafExpressionBranch{
+			truthyDest:     &conditionDestination{id: then},
+			falseyReturnID: els,
+		}},
+		then: {id: then, returnID: -1},
+		els:  {id: els, returnID: -1},
+	}
+
+	got, _ := tunnelChunks(chunks, map[int]bool{})
+
+	for _, linkID := range []int{linkA, linkB} {
+		if _, ok := got[linkID]; ok {
+			t.Errorf("expected empty linker chunk %d to be tunneled away, but it survived", linkID)
+		}
+	}
+
+	leaves := []struct {
+		id   int
+		next int
+	}{
+		{leafA, leafB},
+		{leafB, leafC},
+		{leafC, then},
+	}
+	for _, l := range leaves {
+		c, ok := got[l.id]
+		if !ok {
+			t.Fatalf("expected leaf chunk %d to survive tunneling", l.id)
+		}
+		leaf, ok := c.branchBehavior.(*leafExpressionBranch)
+		if !ok {
+			t.Fatalf("chunk %d: expected leafExpressionBranch, got %T", l.id, c.branchBehavior)
+		}
+		if leaf.truthyDest.id != l.next {
+			t.Errorf("chunk %d: truthyDest = %d, want %d (a direct chain with no intervening goto)", l.id, leaf.truthyDest.id, l.next)
+		}
+		if leaf.falseyReturnID != els {
+			t.Errorf("chunk %d: falseyReturnID = %d, want %d", l.id, leaf.falseyReturnID, els)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+// Command poryscript compiles a Poryscript source file into the
+// target decomp's assembler-style scripting language.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/huderlem/poryscript/backends"
+	"github.com/huderlem/poryscript/emitter"
+	"github.com/huderlem/poryscript/lexer"
+	"github.com/huderlem/poryscript/parser"
+	"github.com/huderlem/poryscript/peephole"
+)
+
+func main() {
+	input := flag.String("i", "", "Input Poryscript file (required)")
+	output := flag.String("o", "", "Output file (default stdout)")
+	optimize := flag.Bool("optimize", true, "Enable chunk layout optimization (tunneling and fall-through ordering)")
+	noDuplicate := flag.Bool("no-duplicate", false, "Disable tail-duplication of small multi-predecessor chunks")
+	peepholeFlag := flag.String("peephole", "safe", "Peephole optimization level: off, safe, or aggressive")
+	target := flag.String("target", "gba", "Output target: gba, crystal, or json")
+	flag.Parse()
+
+	if *input == "" {
+		fmt.Fprintln(os.Stderr, "missing required -i input file")
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	peepholeMode, ok := peephole.ParseMode(*peepholeFlag)
+	if !ok {
+		fmt.Fprintf(os.Stderr, "invalid -peephole value '%s': must be off, safe, or aggressive\n", *peepholeFlag)
+		os.Exit(1)
+	}
+
+	backend, ok := parseBackend(*target)
+	if !ok {
+		fmt.Fprintf(os.Stderr, "invalid -target value '%s': must be gba, crystal, or json\n", *target)
+		os.Exit(1)
+	}
+
+	data, err := ioutil.ReadFile(*input)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "could not read input file '%s': %s\n", *input, err)
+		os.Exit(1)
+	}
+
+	l := lexer.New(string(data))
+	p := parser.New(l)
+	program, err := p.ParseProgram()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "could not parse '%s': %s\n", *input, err)
+		os.Exit(1)
+	}
+
+	e := emitter.New(program, *optimize, *noDuplicate, peepholeMode, backend)
+	result := e.Emit()
+
+	if *output == "" {
+		fmt.Print(result)
+		return
+	}
+	if err := ioutil.WriteFile(*output, []byte(result), 0644); err != nil {
+		fmt.Fprintf(os.Stderr, "could not write output file '%s': %s\n", *output, err)
+		os.Exit(1)
+	}
+}
+
+// parseBackend converts a --target CLI value into the Backend that
+// implements it.
+func parseBackend(s string) (emitter.Backend, bool) {
+	switch s {
+	case "gba":
+		return backends.GBA{}, true
+	case "crystal":
+		return backends.Crystal{}, true
+	case "json":
+		return backends.JSON{}, true
+	default:
+		return nil, false
+	}
+}
@@ -0,0 +1,198 @@
+// Package peephole implements a small rule-based rewriter over the command
+// statements that make up an emitted chunk. Rules match a run of leading
+// statements and replace them with a shorter equivalent, and Run repeats a
+// pass over the rule table until nothing changes.
+//
+// The initial rule set this package was built for also lists "drop a goto
+// to the next chunk in the emitted order." That one isn't registered here:
+// a Rule only ever sees a chunk's own []ast.Statement, and in this IR a
+// goto/jump is never a statement in that list -- it's synthesized at render
+// time from a chunk's branchBehavior and the chosen layout (see
+// chunk.renderBranching), which is exactly where "is this the next chunk
+// anyway" is knowable. Giving Rule a layout parameter just to cover this one
+// case would leak layout concerns into every other rule for no benefit, so
+// renderBranching's existing destChunkID == nextChunkID check is the
+// intended home for it, not a stand-in for a missing rule.
+package peephole
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/huderlem/poryscript/ast"
+)
+
+// Mode selects how aggressively the peephole optimizer rewrites a chunk's
+// statements.
+type Mode int
+
+const (
+	// Off disables the peephole pass entirely.
+	Off Mode = iota
+	// Safe runs only rules that cannot change observable behavior.
+	Safe
+	// Aggressive also runs rules that rely on conventional command
+	// semantics, such as folding two addvar calls into one.
+	Aggressive
+)
+
+// ParseMode converts a --peephole CLI value into a Mode.
+func ParseMode(s string) (Mode, bool) {
+	switch s {
+	case "off":
+		return Off, true
+	case "safe":
+		return Safe, true
+	case "aggressive":
+		return Aggressive, true
+	default:
+		return Off, false
+	}
+}
+
+// Rule rewrites a run of statements at the start of stmts. It returns the
+// number of leading statements it consumed and their replacement. A return
+// of (0, nil) means the rule didn't match.
+type Rule func(stmts []ast.Statement) (int, []ast.Statement)
+
+type registration struct {
+	name       string
+	aggressive bool
+	rule       Rule
+}
+
+var registry []registration
+
+// Register adds a named rule to the peephole rule table so contributors can
+// extend it without editing Run. Registered rules run under both Safe and
+// Aggressive mode. Use RegisterAggressive instead for a rule that depends on
+// conventional command semantics Safe isn't willing to assume.
+func Register(name string, match func(stmts []ast.Statement) (int, []ast.Statement)) {
+	registry = append(registry, registration{name: name, rule: match})
+}
+
+// RegisterAggressive adds a named rule that only runs under Aggressive mode.
+func RegisterAggressive(name string, match func(stmts []ast.Statement) (int, []ast.Statement)) {
+	registry = append(registry, registration{name: name, aggressive: true, rule: match})
+}
+
+func init() {
+	Register("merge-duplicate-lock", mergeDuplicateCommand("lock"))
+	Register("merge-duplicate-releaseall", mergeDuplicateCommand("releaseall"))
+	Register("drop-redundant-setvar", dropRedundantSetvar)
+	RegisterAggressive("fold-addvar-literals", foldAddvarLiterals)
+}
+
+// Run rewrites stmts according to every registered rule that applies under
+// mode, repeating passes until one makes no further changes.
+func Run(stmts []ast.Statement, mode Mode) []ast.Statement {
+	if mode == Off {
+		return stmts
+	}
+	for {
+		next, changed := runPass(stmts, mode)
+		stmts = next
+		if !changed {
+			return stmts
+		}
+	}
+}
+
+func runPass(stmts []ast.Statement, mode Mode) ([]ast.Statement, bool) {
+	result := make([]ast.Statement, 0, len(stmts))
+	changed := false
+	for i := 0; i < len(stmts); {
+		matched := false
+		for _, reg := range registry {
+			if reg.aggressive && mode != Aggressive {
+				continue
+			}
+			n, replacement := reg.rule(stmts[i:])
+			if n == 0 {
+				continue
+			}
+			result = append(result, replacement...)
+			i += n
+			matched = true
+			changed = true
+			break
+		}
+		if !matched {
+			result = append(result, stmts[i])
+			i++
+		}
+	}
+	return result, changed
+}
+
+// mergeDuplicateCommand collapses two consecutive calls to the same
+// zero-effect-when-repeated command (e.g. "lock", "releaseall") into one.
+func mergeDuplicateCommand(name string) Rule {
+	return func(stmts []ast.Statement) (int, []ast.Statement) {
+		if len(stmts) < 2 {
+			return 0, nil
+		}
+		first, ok := stmts[0].(*ast.CommandStatement)
+		if !ok || first.Name.Value != name {
+			return 0, nil
+		}
+		second, ok := stmts[1].(*ast.CommandStatement)
+		if !ok || second.Name.Value != name {
+			return 0, nil
+		}
+		return 2, []ast.Statement{first}
+	}
+}
+
+// dropRedundantSetvar removes a "setvar VAR, X" that's immediately
+// overwritten by another "setvar VAR, Y", since the first write is never
+// observed.
+func dropRedundantSetvar(stmts []ast.Statement) (int, []ast.Statement) {
+	if len(stmts) < 2 {
+		return 0, nil
+	}
+	first, ok := stmts[0].(*ast.CommandStatement)
+	if !ok || first.Name.Value != "setvar" || len(first.Args) == 0 {
+		return 0, nil
+	}
+	second, ok := stmts[1].(*ast.CommandStatement)
+	if !ok || second.Name.Value != "setvar" || len(second.Args) == 0 {
+		return 0, nil
+	}
+	if first.Args[0] != second.Args[0] {
+		return 0, nil
+	}
+	return 2, []ast.Statement{second}
+}
+
+// foldAddvarLiterals combines "addvar VAR, A" followed by "addvar VAR, B"
+// into a single "addvar VAR, A+B" when both operands are integer literals.
+func foldAddvarLiterals(stmts []ast.Statement) (int, []ast.Statement) {
+	if len(stmts) < 2 {
+		return 0, nil
+	}
+	first, ok := stmts[0].(*ast.CommandStatement)
+	if !ok || first.Name.Value != "addvar" || len(first.Args) != 2 {
+		return 0, nil
+	}
+	second, ok := stmts[1].(*ast.CommandStatement)
+	if !ok || second.Name.Value != "addvar" || len(second.Args) != 2 {
+		return 0, nil
+	}
+	if first.Args[0] != second.Args[0] {
+		return 0, nil
+	}
+	a, err := strconv.Atoi(strings.TrimSpace(first.Args[1]))
+	if err != nil {
+		return 0, nil
+	}
+	b, err := strconv.Atoi(strings.TrimSpace(second.Args[1]))
+	if err != nil {
+		return 0, nil
+	}
+	folded := &ast.CommandStatement{
+		Name: first.Name,
+		Args: []string{first.Args[0], strconv.Itoa(a + b)},
+	}
+	return 2, []ast.Statement{folded}
+}
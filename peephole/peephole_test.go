@@ -0,0 +1,123 @@
+package peephole
+
+import (
+	"testing"
+
+	"github.com/huderlem/poryscript/ast"
+)
+
+func command(name string, args ...string) *ast.CommandStatement {
+	return &ast.CommandStatement{Name: &ast.Identifier{Value: name}, Args: args}
+}
+
+func names(stmts []ast.Statement) []string {
+	out := make([]string, len(stmts))
+	for i, stmt := range stmts {
+		cmd, ok := stmt.(*ast.CommandStatement)
+		if !ok {
+			out[i] = "<non-command>"
+			continue
+		}
+		out[i] = cmd.Name.Value
+	}
+	return out
+}
+
+func TestDropRedundantSetvarKeepsTheSecondWrite(t *testing.T) {
+	n, result := dropRedundantSetvar([]ast.Statement{
+		command("setvar", "VAR_FLAG", "1"),
+		command("setvar", "VAR_FLAG", "2"),
+	})
+	if n != 2 {
+		t.Fatalf("n = %d, want 2", n)
+	}
+	if len(result) != 1 {
+		t.Fatalf("result = %v, want a single statement", names(result))
+	}
+	kept := result[0].(*ast.CommandStatement)
+	if kept.Args[1] != "2" {
+		t.Errorf("kept write has value %q, want the second write's value %q", kept.Args[1], "2")
+	}
+}
+
+func TestDropRedundantSetvarIgnoresDifferentVars(t *testing.T) {
+	stmts := []ast.Statement{
+		command("setvar", "VAR_A", "1"),
+		command("setvar", "VAR_B", "2"),
+	}
+	n, result := dropRedundantSetvar(stmts)
+	if n != 0 || result != nil {
+		t.Fatalf("got (%d, %v), want no match since the writes target different vars", n, result)
+	}
+}
+
+func TestFoldAddvarLiteralsSumsBothOperands(t *testing.T) {
+	n, result := foldAddvarLiterals([]ast.Statement{
+		command("addvar", "VAR_COUNT", "2"),
+		command("addvar", "VAR_COUNT", "3"),
+	})
+	if n != 2 {
+		t.Fatalf("n = %d, want 2", n)
+	}
+	if len(result) != 1 {
+		t.Fatalf("result = %v, want a single folded statement", names(result))
+	}
+	folded := result[0].(*ast.CommandStatement)
+	if folded.Args[1] != "5" {
+		t.Errorf("folded value = %q, want \"5\"", folded.Args[1])
+	}
+}
+
+func TestFoldAddvarLiteralsSkipsNonLiteralOperands(t *testing.T) {
+	n, result := foldAddvarLiterals([]ast.Statement{
+		command("addvar", "VAR_COUNT", "VAR_OTHER"),
+		command("addvar", "VAR_COUNT", "3"),
+	})
+	if n != 0 || result != nil {
+		t.Fatalf("got (%d, %v), want no match since the first operand isn't an integer literal", n, result)
+	}
+}
+
+func TestRunFixpointLoopCollapsesThreeLocksIntoOne(t *testing.T) {
+	stmts := []ast.Statement{
+		command("lock"),
+		command("lock"),
+		command("lock"),
+		command("msgbox", "gText_Example"),
+	}
+	result := Run(stmts, Safe)
+	got := names(result)
+	want := []string{"lock", "msgbox"}
+	if len(got) != len(want) {
+		t.Fatalf("Run(stmts, Safe) = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("Run(stmts, Safe) = %v, want %v", got, want)
+		}
+	}
+}
+
+func TestRunSafeModeSkipsAggressiveRules(t *testing.T) {
+	stmts := []ast.Statement{
+		command("addvar", "VAR_COUNT", "2"),
+		command("addvar", "VAR_COUNT", "3"),
+	}
+	result := Run(stmts, Safe)
+	if len(result) != 2 {
+		t.Fatalf("Run(stmts, Safe) = %v, want the aggressive fold-addvar-literals rule left untouched", names(result))
+	}
+
+	result = Run(stmts, Aggressive)
+	if len(result) != 1 {
+		t.Fatalf("Run(stmts, Aggressive) = %v, want the two addvar calls folded into one", names(result))
+	}
+}
+
+func TestRunOffModeLeavesStatementsUntouched(t *testing.T) {
+	stmts := []ast.Statement{command("lock"), command("lock")}
+	result := Run(stmts, Off)
+	if len(result) != 2 {
+		t.Fatalf("Run(stmts, Off) = %v, want the input left untouched", names(result))
+	}
+}